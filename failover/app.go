@@ -0,0 +1,227 @@
+package failover
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ngaut/log"
+)
+
+// App ties together the health checker, the raft-backed master set and
+// the RESP listener that exposes it to the outside world.
+type App struct {
+	sync.RWMutex
+
+	cfg *Config
+
+	masters *Masters
+	r       *Raft
+	pubsub  *pubsub
+	sdown   *sdownTracker
+
+	listener      net.Listener
+	sdownListener net.Listener
+
+	groups map[string]*Group
+
+	// ring is the health-check hash ring used by CheckSharding; nil
+	// otherwise, in which case owns always returns true.
+	ring *hashRing
+
+	// shardsByMaster is only used in ModeCluster, keyed by the shard's
+	// current master address.
+	shardsByMaster map[string]*Shard
+
+	// downSince tracks, per master, when this node first saw it fail to
+	// respond to PING; it is local to this node, not replicated, and is
+	// what down-after-milliseconds is measured against before a SDOWN
+	// vote is gossiped to the leader.
+	downSince map[string]time.Time
+
+	// slaveLinkDownSince tracks, per slave, when its master_link_status
+	// was first seen "down"; doElect uses it to skip slaves that have
+	// been disconnected for too long to trust their offset.
+	slaveLinkDownSince map[string]time.Time
+
+	beforeHandlers []BeforeFailoverHandler
+	afterHandlers  []AfterFailoverHandler
+
+	shardBeforeHandlers []ShardBeforeFailoverHandler
+	shardAfterHandlers  []ShardAfterFailoverHandler
+
+	quitCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewApp creates an App from cfg, starting its raft node and RESP
+// listener but not yet the health checking loop; call Run to start
+// serving.
+func NewApp(cfg *Config) (*App, error) {
+	app := &App{
+		cfg:                cfg,
+		masters:            newMasters(),
+		pubsub:             newPubSub(),
+		sdown:              newSDownTracker(),
+		groups:             make(map[string]*Group),
+		shardsByMaster:     make(map[string]*Shard),
+		downSince:          make(map[string]time.Time),
+		slaveLinkDownSince: make(map[string]time.Time),
+		quitCh:             make(chan struct{}),
+	}
+
+	r, err := newRaft(cfg.Raft, app.masters)
+	if err != nil {
+		return nil, err
+	}
+	app.r = r
+
+	l, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	app.listener = l
+
+	if err := app.startSDownService(); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Masters) > 0 {
+		if err := app.addMasters(cfg.Masters); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, g := range cfg.Groups {
+		if err := app.addMasters([]string{g.Addr}); err != nil {
+			return nil, err
+		}
+		if err := app.setMasterName(g.Addr, g.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return app, nil
+}
+
+// redisConfigFor returns the dial configuration to use for addr: its
+// per-address override if one is configured, otherwise the cluster-wide
+// default.
+func (app *App) redisConfigFor(addr string) *RedisConfig {
+	if override, ok := app.cfg.RedisOverrides[addr]; ok {
+		return &override
+	}
+
+	return &app.cfg.Redis
+}
+
+// addMasters proposes the given addresses to the masters FSM through
+// raft, so every node in the cluster agrees on the monitored set.
+func (app *App) addMasters(addrs []string) error {
+	cmd := &mastersCmd{Type: cmdAddMasters, Addrs: addrs}
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	return app.r.Apply(data, 5*time.Second)
+}
+
+func (app *App) removeMaster(addr string) error {
+	cmd := &mastersCmd{Type: cmdRemoveMaster, Addrs: []string{addr}}
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	return app.r.Apply(data, 5*time.Second)
+}
+
+// setMasterName associates a logical name with addr, so Sentinel-style
+// clients can look the group up by name instead of by address.
+func (app *App) setMasterName(addr string, name string) error {
+	cmd := &mastersCmd{Type: cmdSetMasterName, Addr: addr, Name: name}
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	return app.r.Apply(data, 5*time.Second)
+}
+
+// setSlavePriority proposes a new promotion priority for a slave
+// address through raft, so every node's doElect agrees on it.
+func (app *App) setSlavePriority(addr string, priority int) error {
+	cmd := &mastersCmd{Type: cmdSetSlavePriority, Addr: addr, Priority: priority}
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	return app.r.Apply(data, 5*time.Second)
+}
+
+// markSlaveLinkDown records the first time addr's replication link was
+// seen down and returns how long it has been down for.
+func (app *App) markSlaveLinkDown(addr string) time.Duration {
+	app.Lock()
+	defer app.Unlock()
+
+	since, ok := app.slaveLinkDownSince[addr]
+	if !ok {
+		since = time.Now()
+		app.slaveLinkDownSince[addr] = since
+	}
+
+	return time.Since(since)
+}
+
+func (app *App) clearSlaveLinkDown(addr string) {
+	app.Lock()
+	defer app.Unlock()
+
+	delete(app.slaveLinkDownSince, addr)
+}
+
+// Run starts the health check loop and the RESP listener. It blocks
+// until Close is called.
+func (app *App) Run() error {
+	app.wg.Add(1)
+	go app.checkLoop()
+
+	for {
+		conn, err := app.listener.Accept()
+		if err != nil {
+			select {
+			case <-app.quitCh:
+				return nil
+			default:
+				log.Errorf("accept error %v", err)
+				continue
+			}
+		}
+
+		app.wg.Add(1)
+		go app.handleConn(conn)
+	}
+}
+
+// Close stops the health check loop, the RESP listener and the raft
+// node.
+func (app *App) Close() {
+	select {
+	case <-app.quitCh:
+		return
+	default:
+		close(app.quitCh)
+	}
+
+	app.listener.Close()
+	app.sdownListener.Close()
+	app.wg.Wait()
+
+	if err := app.r.Close(); err != nil {
+		log.Errorf("close raft err %v", err)
+	}
+}
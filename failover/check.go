@@ -0,0 +1,139 @@
+package failover
+
+import (
+	"time"
+
+	"github.com/ngaut/log"
+)
+
+const defaultCheckInterval = 3000
+
+func (app *App) checkInterval() time.Duration {
+	interval := app.cfg.CheckInterval
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+
+	return time.Duration(interval) * time.Millisecond
+}
+
+// checkLoop periodically pings every monitored master. Every node in
+// the cluster runs this, not just the leader: each one independently
+// decides a master is subjectively down (SDOWN) after it has failed to
+// respond for DownAfter, and gossips that opinion to the leader, which
+// is the only node that turns enough matching opinions into an
+// objective down (ODOWN) and actually starts a failover.
+func (app *App) checkLoop() {
+	defer app.wg.Done()
+
+	ticker := time.NewTicker(app.checkInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			app.checkMasters()
+		case <-app.quitCh:
+			return
+		}
+	}
+}
+
+func (app *App) checkMasters() {
+	if app.cfg.CheckSharding {
+		app.rebuildRing()
+	}
+
+	if app.cfg.Mode == ModeCluster {
+		app.checkCluster()
+		return
+	}
+
+	for _, addr := range app.masters.GetMasters() {
+		if app.cfg.CheckSharding && !app.owns(addr) {
+			continue
+		}
+		app.checkMaster(addr)
+	}
+}
+
+func (app *App) checkMaster(addr string) {
+	g := newGroup(addr)
+	g.cfg = app.redisConfigFor(addr)
+	if err := g.doRole(); err == nil {
+		g.refreshHealth(app)
+
+		app.Lock()
+		app.groups[addr] = g
+		delete(app.downSince, addr)
+		app.Unlock()
+		return
+	}
+
+	if err := ping(app.redisConfigFor(addr), addr); err == nil {
+		app.Lock()
+		delete(app.downSince, addr)
+		app.Unlock()
+		return
+	}
+
+	app.Lock()
+	since, ok := app.downSince[addr]
+	if !ok {
+		since = time.Now()
+		app.downSince[addr] = since
+	}
+	app.Unlock()
+
+	if time.Since(since) >= app.downAfter() {
+		log.Errorf("master %s SDOWN, reporting to leader", addr)
+		app.recordSDown(addr)
+	}
+}
+
+// failover is called by the leader once addr has reached ODOWN (Quorum
+// distinct nodes agree it is SDOWN). It notifies the before-handlers,
+// promotes a replacement from the last known group topology if one is
+// available, and notifies the after-handlers.
+func (app *App) failover(addr string) {
+	name := app.masters.Name(addr)
+
+	app.runBeforeHandlers(addr)
+
+	app.Lock()
+	g := app.groups[addr]
+	delete(app.groups, addr)
+	app.Unlock()
+
+	if err := app.removeMaster(addr); err != nil {
+		log.Errorf("remove down master %s err %v", addr, err)
+	}
+
+	if g == nil || len(g.Slaves) == 0 {
+		log.Errorf("master %s is down and has no known slave to promote", addr)
+		return
+	}
+
+	newAddr := app.doElect(g)
+	if newAddr == "" {
+		log.Errorf("master %s is down and has no eligible slave to promote", addr)
+		return
+	}
+
+	if _, err := doCommand(app.redisConfigFor(newAddr), newAddr, "SLAVEOF", "NO", "ONE"); err != nil {
+		log.Errorf("promote %s to master err %v", newAddr, err)
+		return
+	}
+
+	if err := app.addMasters([]string{newAddr}); err != nil {
+		log.Errorf("add new master %s err %v", newAddr, err)
+		return
+	}
+
+	if err := app.setMasterName(newAddr, name); err != nil {
+		log.Errorf("carry master name %s over to %s err %v", name, newAddr, err)
+	}
+
+	app.runAfterHandlers(addr, newAddr)
+	app.publishSwitchMaster(name, addr, newAddr)
+}
@@ -0,0 +1,322 @@
+package failover
+
+import (
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/ngaut/log"
+)
+
+// ClusterNode is a single line of a CLUSTER NODES reply.
+type ClusterNode struct {
+	ID     string
+	Addr   string
+	Flags  []string
+	Master string // master node id, empty if this node is itself a master
+	Slots  []string
+}
+
+func (n *ClusterNode) hasFlag(flag string) bool {
+	for _, f := range n.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *ClusterNode) isMaster() bool { return n.hasFlag("master") }
+func (n *ClusterNode) isFailed() bool { return n.hasFlag("fail") || n.hasFlag("fail?") }
+
+// Shard is one master and its replicas inside a Redis Cluster
+// deployment, identified by the cluster node ID of its current master.
+// That ID survives a change of the master node's address, but a
+// promoted replica has a node ID of its own, so after a failover the
+// shard is identified by the new master's ID.
+type Shard struct {
+	ID       string
+	Master   string
+	Replicas []string
+	Slots    []string
+}
+
+// parseClusterNodes parses the plain text CLUSTER NODES reply into one
+// ClusterNode per line. Unparsable lines are skipped rather than
+// failing the whole reply, since CLUSTER NODES output is line-oriented
+// and a single malformed line (e.g. mid-gossip-propagation) shouldn't
+// blind the checker to every other node.
+func parseClusterNodes(raw string) []*ClusterNode {
+	lines := strings.Split(strings.TrimSpace(raw), "\n")
+	nodes := make([]*ClusterNode, 0, len(lines))
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+
+		addr := fields[1]
+		if i := strings.IndexByte(addr, '@'); i >= 0 {
+			addr = addr[:i]
+		}
+
+		n := &ClusterNode{
+			ID:    fields[0],
+			Addr:  addr,
+			Flags: strings.Split(fields[2], ","),
+		}
+
+		if fields[3] != "-" {
+			n.Master = fields[3]
+		}
+
+		if len(fields) > 8 {
+			n.Slots = fields[8:]
+		}
+
+		nodes = append(nodes, n)
+	}
+
+	return nodes
+}
+
+// clusterNodes runs CLUSTER NODES against seedAddr.
+func clusterNodes(cfg *RedisConfig, seedAddr string) ([]*ClusterNode, error) {
+	reply, err := doCommand(cfg, seedAddr, "CLUSTER", "NODES")
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := redis.String(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseClusterNodes(raw), nil
+}
+
+// buildShards groups a CLUSTER NODES reply into one Shard per master,
+// keyed by the master's cluster node ID.
+func buildShards(nodes []*ClusterNode) map[string]*Shard {
+	shards := make(map[string]*Shard)
+
+	for _, n := range nodes {
+		if !n.isMaster() || n.isFailed() {
+			continue
+		}
+
+		shards[n.ID] = &Shard{ID: n.ID, Master: n.Addr, Slots: n.Slots}
+	}
+
+	for _, n := range nodes {
+		if n.isMaster() || n.Master == "" {
+			continue
+		}
+
+		shard, ok := shards[n.Master]
+		if !ok {
+			continue
+		}
+
+		shard.Replicas = append(shard.Replicas, n.Addr)
+	}
+
+	return shards
+}
+
+// checkCluster discovers the current Redis Cluster topology through
+// whichever configured seed still answers, reconciles it against what
+// this node already knew, and checks every shard master it now knows
+// about.
+func (app *App) checkCluster() {
+	seeds := app.masters.GetMasters()
+
+	var nodes []*ClusterNode
+	var err error
+	for _, seed := range seeds {
+		if nodes, err = clusterNodes(app.redisConfigFor(seed), seed); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		log.Errorf("discover cluster topology via seeds %v err %v", seeds, err)
+		return
+	}
+
+	shards := buildShards(nodes)
+	app.reconcileShards(shards)
+
+	for _, shard := range shards {
+		if app.cfg.CheckSharding && !app.owns(shard.Master) {
+			continue
+		}
+		app.checkShard(shard)
+	}
+}
+
+// reconcileShards brings the masters FSM and this node's shard cache in
+// line with a freshly discovered topology: new shards are added, gone
+// ones removed, and a known shard ID now reported at a different master
+// address gets its after-handlers run with the old and new address. A
+// replica promoted by Redis Cluster's own failover carries a new node
+// ID, so it shows up here as one shard removed and another added, and
+// no after-handlers are run for it.
+func (app *App) reconcileShards(shards map[string]*Shard) {
+	app.Lock()
+	if app.shardsByMaster == nil {
+		app.shardsByMaster = make(map[string]*Shard)
+	}
+	prevAddrByID := make(map[string]string, len(app.shardsByMaster))
+	for addr, shard := range app.shardsByMaster {
+		prevAddrByID[shard.ID] = addr
+	}
+	app.Unlock()
+
+	seen := make(map[string]bool, len(shards))
+
+	for _, shard := range shards {
+		seen[shard.Master] = true
+
+		prevAddr, known := prevAddrByID[shard.ID]
+		if !known {
+			if err := app.addMasters([]string{shard.Master}); err != nil {
+				log.Errorf("add shard %s master %s err %v", shard.ID, shard.Master, err)
+			}
+			if err := app.setMasterName(shard.Master, shard.ID); err != nil {
+				log.Errorf("name shard %s err %v", shard.ID, err)
+			}
+		} else if prevAddr != shard.Master {
+			if err := app.removeMaster(prevAddr); err != nil {
+				log.Errorf("remove stale shard %s master %s err %v", shard.ID, prevAddr, err)
+			}
+			if err := app.addMasters([]string{shard.Master}); err != nil {
+				log.Errorf("add shard %s master %s err %v", shard.ID, shard.Master, err)
+			}
+			if err := app.setMasterName(shard.Master, shard.ID); err != nil {
+				log.Errorf("name shard %s err %v", shard.ID, err)
+			}
+
+			app.runShardAfterHandlers(shard.ID, prevAddr, shard.Master)
+		}
+
+		app.Lock()
+		app.shardsByMaster[shard.Master] = shard
+		app.Unlock()
+	}
+
+	app.Lock()
+	for addr, shard := range app.shardsByMaster {
+		if !seen[addr] {
+			delete(app.shardsByMaster, addr)
+			if err := app.removeMaster(addr); err != nil {
+				log.Errorf("remove gone shard %s master %s err %v", shard.ID, addr, err)
+			}
+		}
+	}
+	app.Unlock()
+}
+
+func (app *App) checkShard(shard *Shard) {
+	if err := ping(app.redisConfigFor(shard.Master), shard.Master); err == nil {
+		app.Lock()
+		delete(app.downSince, shard.Master)
+		app.Unlock()
+		return
+	}
+
+	app.Lock()
+	since, ok := app.downSince[shard.Master]
+	if !ok {
+		since = time.Now()
+		app.downSince[shard.Master] = since
+	}
+	app.Unlock()
+
+	if time.Since(since) >= app.downAfter() {
+		log.Errorf("shard %s master %s SDOWN, reporting to leader", shard.ID, shard.Master)
+		app.recordSDown(shard.Master)
+	}
+}
+
+// electShardReplica picks the replica to promote for shard. CLUSTER
+// NODES, unlike ROLE, exposes no per-replica priority or offset, so
+// reachability is the only signal available here: it returns the first
+// replica, in CLUSTER NODES' own order, that still answers PING, or ""
+// if none do.
+func (app *App) electShardReplica(shard *Shard) string {
+	for _, addr := range shard.Replicas {
+		if err := ping(app.redisConfigFor(addr), addr); err == nil {
+			return addr
+		}
+	}
+
+	return ""
+}
+
+// failoverShard is the ModeCluster counterpart of failover: instead of
+// SLAVEOF NO ONE on a chosen slave, it asks a replica to CLUSTER
+// FAILOVER itself, which hands the shard's slots over within the
+// cluster's own slot map.
+func (app *App) failoverShard(addr string) {
+	name := app.masters.Name(addr)
+
+	app.runBeforeHandlers(addr)
+	app.runShardBeforeHandlers(name, addr)
+
+	app.Lock()
+	shard := app.shardsByMaster[addr]
+	delete(app.shardsByMaster, addr)
+	app.Unlock()
+
+	if err := app.removeMaster(addr); err != nil {
+		log.Errorf("remove down shard master %s err %v", addr, err)
+	}
+
+	if shard == nil || len(shard.Replicas) == 0 {
+		log.Errorf("shard %s master %s is down and has no known replica to promote", name, addr)
+		return
+	}
+
+	newAddr := app.electShardReplica(shard)
+	if newAddr == "" {
+		log.Errorf("shard %s master %s is down and has no reachable replica to promote", name, addr)
+		return
+	}
+
+	failoverArgs := []interface{}{"FAILOVER"}
+	if opt := app.cfg.ClusterFailoverOption; opt != "" {
+		failoverArgs = append(failoverArgs, opt)
+	}
+
+	if _, err := doCommand(app.redisConfigFor(newAddr), newAddr, "CLUSTER", failoverArgs...); err != nil {
+		log.Errorf("CLUSTER FAILOVER on %s for shard %s err %v", newAddr, name, err)
+		return
+	}
+
+	if err := app.addMasters([]string{newAddr}); err != nil {
+		log.Errorf("add new shard %s master %s err %v", name, newAddr, err)
+		return
+	}
+
+	if err := app.setMasterName(newAddr, name); err != nil {
+		log.Errorf("carry shard name %s over to %s err %v", name, newAddr, err)
+	}
+
+	app.runAfterHandlers(addr, newAddr)
+	app.runShardAfterHandlers(name, addr, newAddr)
+	app.publishSwitchMaster(name, addr, newAddr)
+}
+
+// GetShardSlots returns the slot ranges, in CLUSTER NODES' own textual
+// form (e.g. "0-5460"), owned by the shard whose master is addr.
+func (app *App) GetShardSlots(addr string) []string {
+	app.RLock()
+	defer app.RUnlock()
+
+	if shard := app.shardsByMaster[addr]; shard != nil {
+		return shard.Slots
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package failover
+
+import "time"
+
+// Raft cluster states, used to tell a node whether it is joining a brand
+// new cluster or attaching itself to one that already has members.
+const (
+	ClusterStateNew      = "new"
+	ClusterStateExisting = "existing"
+)
+
+// Monitoring modes. ModeReplication is a set of independent
+// master/slave groups, discovered with ROLE. ModeCluster is a single
+// Redis Cluster deployment, discovered with CLUSTER NODES.
+const (
+	ModeReplication = "replication"
+	ModeCluster     = "cluster"
+)
+
+// RaftConfig holds the configuration needed to start the embedded raft
+// node used for leader election among the failover processes.
+type RaftConfig struct {
+	Addr    string `toml:"addr"`
+	DataDir string `toml:"data_dir"`
+	LogDir  string `toml:"log_dir"`
+
+	// ClusterState is either ClusterStateNew or ClusterStateExisting.
+	ClusterState string `toml:"cluster_state"`
+
+	// Cluster is the full list of raft peer addresses, including this
+	// node's own Raft.Addr.
+	Cluster []string `toml:"cluster"`
+
+	// GossipPortOffset is added to a node's raft port to get the port
+	// its SDOWN-gossip RPC service listens on. It must be large enough
+	// that raft_port+offset can never land on another configured
+	// peer's raft port; peers are conventionally given consecutive
+	// raft ports, so a small offset like 1 will eventually collide
+	// with a neighbor's raft transport. Defaults to
+	// defaultGossipPortOffset.
+	GossipPortOffset int `toml:"gossip_port_offset"`
+}
+
+// MasterGroup names a monitored master, the same way a Sentinel config
+// file's "sentinel monitor <name> <ip> <port> <quorum>" line does. It is
+// only needed when clients want to address the group with SENTINEL
+// rather than the master's current address.
+type MasterGroup struct {
+	Name string `toml:"name"`
+	Addr string `toml:"addr"`
+}
+
+// TLSConfig configures a TLS connection to a monitored Redis instance.
+// It is considered enabled as soon as CAFile or CertFile is set.
+type TLSConfig struct {
+	CAFile             string `toml:"ca_file"`
+	CertFile           string `toml:"cert_file"`
+	KeyFile            string `toml:"key_file"`
+	ServerName         string `toml:"server_name"`
+	InsecureSkipVerify bool   `toml:"insecure_skip_verify"`
+}
+
+func (t TLSConfig) enabled() bool {
+	return t.CAFile != "" || t.CertFile != ""
+}
+
+// RedisConfig configures how the module dials a monitored Redis
+// instance: TLS and AUTH credentials. The zero value dials plaintext
+// with no credentials, matching the module's original behavior.
+type RedisConfig struct {
+	// Username is only sent if non-empty, for Redis 6+ ACL AUTH; plain
+	// AUTH <password> is used otherwise.
+	Username string    `toml:"username"`
+	Password string    `toml:"password"`
+	TLS      TLSConfig `toml:"tls"`
+}
+
+// Config is the top level configuration for an App.
+type Config struct {
+	// Addr is the address the app listens on for the admin/RESP protocol.
+	Addr string `toml:"addr"`
+
+	// Mode is ModeReplication (the default) or ModeCluster.
+	Mode string `toml:"mode"`
+
+	// ClusterFailoverOption is passed as the optional argument to
+	// CLUSTER FAILOVER when promoting a replica in ModeCluster: "" for
+	// a clean failover, "FORCE" or "TAKEOVER" otherwise. It is ignored
+	// in ModeReplication.
+	ClusterFailoverOption string `toml:"cluster_failover_option"`
+
+	// Masters is the initial list of master addresses to monitor. In
+	// ModeCluster these are seed nodes used to discover the rest of the
+	// cluster with CLUSTER NODES, rather than the full set of masters.
+	Masters []string `toml:"masters"`
+
+	// Groups optionally names some or all of Masters, so Sentinel-style
+	// clients can discover them with SENTINEL get-master-addr-by-name.
+	// An address listed here does not also need to be repeated in
+	// Masters; NewApp adds it automatically.
+	Groups []MasterGroup `toml:"groups"`
+
+	// CheckInterval is the interval, in milliseconds, between two
+	// consecutive health checks of a master.
+	CheckInterval int64 `toml:"check_interval"`
+
+	// DownAfter is how long a master must fail to respond to PING
+	// before this node subjectively considers it down (SDOWN) and
+	// starts gossiping that to the leader.
+	DownAfter time.Duration `toml:"down_after"`
+
+	// Quorum is the number of distinct nodes that must agree a master
+	// is SDOWN within the sliding window before the leader promotes it
+	// to ODOWN and starts a failover. It defaults to 1, matching the
+	// previous leader-only behavior. See CheckSharding below before
+	// raising it in a CheckSharding deployment.
+	Quorum int `toml:"quorum"`
+
+	// SlaveLinkDownThreshold is how long a slave's master_link_status
+	// may stay "down" before doElect stops considering it eligible for
+	// promotion.
+	SlaveLinkDownThreshold time.Duration `toml:"slave_link_down_threshold"`
+
+	// MaxSlaveLag is the largest replication offset gap, in bytes,
+	// between a master and one of its slaves before doElect stops
+	// considering that slave eligible for promotion. Zero disables the
+	// check.
+	MaxSlaveLag int64 `toml:"max_slave_lag"`
+
+	// Redis is the default dial configuration used for every monitored
+	// instance.
+	Redis RedisConfig `toml:"redis"`
+
+	// RedisOverrides lets individual addresses, keyed exactly as they
+	// appear in Masters/Groups/discovered replicas, dial differently
+	// than Redis above. This is what makes heterogeneous deployments
+	// (e.g. dev and prod instances behind one failover cluster) work.
+	RedisOverrides map[string]RedisConfig `toml:"redis_overrides"`
+
+	// CheckSharding partitions the monitored masters across the raft
+	// cluster's members with a consistent-hash ring, so each node only
+	// probes the slice that hashes to it instead of every node probing
+	// every master. It defaults to off, which keeps the original
+	// every-node-checks-everything behavior. It only changes who
+	// probes a master, not how a down result is acted on: a probe
+	// failure still goes through the same SDOWN/Quorum tally in
+	// sdown.go as when every node probes everything.
+	//
+	// With CheckSharding on, a master is normally only ever probed by
+	// the single node it hashes to, so Quorum above 1 should not be
+	// combined with it: no second node will ever be around to cast the
+	// corroborating vote, and the master will never reach ODOWN.
+	CheckSharding bool `toml:"check_sharding"`
+
+	Raft RaftConfig `toml:"raft"`
+}
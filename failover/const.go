@@ -0,0 +1,15 @@
+package failover
+
+// Roles reported by the Redis ROLE command.
+const (
+	MasterType = "master"
+	SlaveType  = "slave"
+)
+
+// Replication link states reported by ROLE on a slave.
+const (
+	ConnectedState  = "connected"
+	ConnectState    = "connect"
+	ConnectingState = "connecting"
+	SyncState       = "sync"
+)
@@ -0,0 +1,102 @@
+package failover
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// defaultSlaveLinkDownThresholdMultiplier mirrors Redis Sentinel's own default of
+// ten times down-after-milliseconds.
+const defaultSlaveLinkDownThresholdMultiplier = 10
+
+func (app *App) slaveLinkDownThreshold() time.Duration {
+	if app.cfg.SlaveLinkDownThreshold > 0 {
+		return app.cfg.SlaveLinkDownThreshold
+	}
+
+	return defaultSlaveLinkDownThresholdMultiplier * app.downAfter()
+}
+
+func (app *App) maxSlaveLag() int64 {
+	return app.cfg.MaxSlaveLag
+}
+
+// doElect picks the replica to promote in place of a failed master,
+// following the same priority order Redis Sentinel uses: lowest
+// configured slave-priority first, then largest replication offset,
+// then lexicographically smallest run id as a stable tiebreaker. Slaves
+// that do not answer PING, slaves with priority 0, a replication link
+// that has been down too long, or too much lag are never considered,
+// and if every slave is disqualified doElect returns "" rather than
+// promote one of them anyway.
+func (app *App) doElect(g *Group) string {
+	candidates := make([]*SlaveInfo, 0, len(g.Slaves))
+
+	for _, sl := range g.Slaves {
+		if sl.Priority == 0 {
+			continue
+		}
+
+		if err := ping(app.redisConfigFor(sl.Addr), sl.Addr); err != nil {
+			continue
+		}
+
+		if sl.LinkStatus == "down" && sl.LinkDownFor > app.slaveLinkDownThreshold() {
+			continue
+		}
+
+		if max := app.maxSlaveLag(); max > 0 && g.Master.Offset-sl.Offset > max {
+			continue
+		}
+
+		candidates = append(candidates, sl)
+	}
+
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		if a.Offset != b.Offset {
+			return a.Offset > b.Offset
+		}
+
+		return a.RunID < b.RunID
+	})
+
+	return candidates[0].Addr
+}
+
+// dispatchSlavePriority handles the module's own SLAVEPRIORITY admin
+// command: SLAVEPRIORITY <addr> <priority>. It has no Sentinel
+// equivalent; Sentinel relies on redis.conf's slave-priority directive
+// instead, but this module has no config file to read per-slave, so it
+// keeps the setting in raft alongside everything else it needs every
+// node to agree on.
+func (app *App) dispatchSlavePriority(w *bufio.Writer, args []string) {
+	if len(args) != 2 {
+		writeError(w, "ERR wrong number of arguments for 'slavepriority' command")
+		return
+	}
+
+	priority, err := strconv.Atoi(args[1])
+	if err != nil {
+		writeError(w, "ERR priority must be an integer")
+		return
+	}
+
+	if err := app.setSlavePriority(args[0], priority); err != nil {
+		writeError(w, fmt.Sprintf("ERR %v", err))
+		return
+	}
+
+	writeSimpleString(w, "OK")
+}
@@ -1,6 +1,7 @@
 package failover
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"github.com/garyburd/redigo/redis"
@@ -9,6 +10,7 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -22,7 +24,7 @@ type failoverTestSuite struct {
 
 var _ = Suite(&failoverTestSuite{})
 
-var testPort = []int{16379, 16380, 16381}
+var testPort = []int{16379, 16380, 16381, 16382}
 
 func (s *failoverTestSuite) SetUpSuite(c *C) {
 	_, err := exec.LookPath("redis-server")
@@ -112,6 +114,7 @@ func (s *failoverTestSuite) TestSimpleCheck(c *C) {
 	port := testPort[0]
 	cfg.Masters = []string{fmt.Sprintf("127.0.0.1:%d", port)}
 	cfg.CheckInterval = 500
+	cfg.DownAfter = time.Second
 
 	app, err := NewApp(cfg)
 	c.Assert(err, IsNil)
@@ -150,6 +153,7 @@ func (s *failoverTestSuite) TestFailoverCheck(c *C) {
 
 	cfg.Masters = []string{masterAddr}
 	cfg.CheckInterval = 500
+	cfg.DownAfter = time.Second
 
 	app, err := NewApp(cfg)
 	c.Assert(err, IsNil)
@@ -173,6 +177,98 @@ func (s *failoverTestSuite) TestFailoverCheck(c *C) {
 	}
 }
 
+func (s *failoverTestSuite) TestElectionPrefersHighestOffset(c *C) {
+	cfg := new(Config)
+	cfg.Addr = ":11000"
+
+	port := testPort[0]
+	masterAddr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	cfg.Masters = []string{masterAddr}
+	cfg.CheckInterval = 500
+	cfg.DownAfter = time.Second
+
+	app, err := NewApp(cfg)
+	c.Assert(err, IsNil)
+
+	defer app.Close()
+
+	ch := s.addAfterHandler(app)
+
+	go func() {
+		app.Run()
+	}()
+
+	// testPort[1] attaches first and catches up on a big batch of
+	// writes; testPort[2] and testPort[3] only attach afterwards, so
+	// they are each left with a smaller replication offset and should
+	// lose the election to testPort[1].
+	s.doCommand(c, testPort[1], "SLAVEOF", "127.0.0.1", port)
+	s.waitReplConnected(c, testPort[1], 10)
+
+	for i := 0; i < 1000; i++ {
+		s.doCommand(c, port, "SET", fmt.Sprintf("k%d", i), i)
+	}
+	s.waitSync(c, port, 10)
+
+	s.doCommand(c, testPort[2], "SLAVEOF", "127.0.0.1", port)
+	s.waitReplConnected(c, testPort[2], 10)
+
+	s.doCommand(c, testPort[3], "SLAVEOF", "127.0.0.1", port)
+	s.waitReplConnected(c, testPort[3], 10)
+
+	s.stopRedis(c, port)
+
+	var newMaster string
+	select {
+	case newMaster = <-ch:
+	case <-time.After(5 * time.Second):
+		c.Fatal("failover is not ok after 5s, too slow")
+	}
+
+	c.Assert(newMaster, Equals, fmt.Sprintf("127.0.0.1:%d", testPort[1]))
+}
+
+// TestDoElectExcludesIneligibleCandidates checks doElect's exclusion
+// rules one at a time: priority 0, a replication link down longer than
+// SlaveLinkDownThreshold, and lag past MaxSlaveLag. With all three
+// slaves disqualified it must return "" rather than promote one of them
+// anyway; fixing the last disqualification should make it return that
+// slave.
+func (s *failoverTestSuite) TestDoElectExcludesIneligibleCandidates(c *C) {
+	apps := s.newClusterApp(c, 1, 80)
+	app := apps[0]
+	defer app.Close()
+
+	select {
+	case b := <-app.r.LeaderCh():
+		c.Assert(b, Equals, true)
+	case <-time.After(5 * time.Second):
+		c.Fatal("elect to leader failed after 5s, too slow")
+	}
+
+	app.cfg.SlaveLinkDownThreshold = time.Second
+	app.cfg.MaxSlaveLag = 10
+
+	g := &Group{
+		Addr:   fmt.Sprintf("127.0.0.1:%d", testPort[0]),
+		Master: &MasterInfo{Addr: fmt.Sprintf("127.0.0.1:%d", testPort[0]), Offset: 1000},
+		Slaves: []*SlaveInfo{
+			// priority 0: never eligible, regardless of anything else.
+			{Addr: fmt.Sprintf("127.0.0.1:%d", testPort[1]), Priority: 0, Offset: 1000},
+			// link down past SlaveLinkDownThreshold.
+			{Addr: fmt.Sprintf("127.0.0.1:%d", testPort[2]), Priority: 1, Offset: 1000, LinkStatus: "down", LinkDownFor: 10 * time.Second},
+			// lag past MaxSlaveLag.
+			{Addr: fmt.Sprintf("127.0.0.1:%d", testPort[3]), Priority: 1, Offset: 100, LinkStatus: "connected"},
+		},
+	}
+
+	c.Assert(app.doElect(g), Equals, "")
+
+	g.Slaves[2].Offset = 995
+	c.Assert(app.doElect(g), Equals, fmt.Sprintf("127.0.0.1:%d", testPort[3]))
+}
+
 func (s *failoverTestSuite) TestOneFaftFailoverCheck(c *C) {
 	apps := s.newClusterApp(c, 1, 0)
 	app := apps[0]
@@ -206,6 +302,74 @@ func (s *failoverTestSuite) TestOneFaftFailoverCheck(c *C) {
 	}
 }
 
+// TestSDownTrackerRecordAndCheckQuorumIsAtomic checks that two
+// concurrent votes for the same addr that both reach quorum only ever
+// cause one of them to win: record-check-clear has to happen as a
+// single critical section, or both callers can observe quorum before
+// either clears the vote set and each starts its own failover for what
+// should be a single event.
+func (s *failoverTestSuite) TestSDownTrackerRecordAndCheckQuorumIsAtomic(c *C) {
+	t := newSDownTracker()
+	t.recordAndCheckQuorum(sdownVote{Addr: "addr", Voter: "node-1"}, 1000, time.Minute)
+
+	var wins int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vote := sdownVote{Addr: "addr", Voter: fmt.Sprintf("node-racer-%d", i)}
+			if t.recordAndCheckQuorum(vote, 2, time.Minute) {
+				atomic.AddInt32(&wins, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	c.Assert(wins, Equals, int32(1))
+}
+
+// TestQuorumGatesFailover checks the one thing chunk0-2 actually added:
+// the leader must not act on a single SDOWN vote once Quorum is raised
+// above the default of 1, and must act as soon as enough distinct
+// voters agree.
+func (s *failoverTestSuite) TestQuorumGatesFailover(c *C) {
+	apps := s.newClusterApp(c, 1, 50)
+	app := apps[0]
+	defer app.Close()
+
+	app.cfg.Quorum = 2
+
+	select {
+	case b := <-app.r.LeaderCh():
+		c.Assert(b, Equals, true)
+	case <-time.After(5 * time.Second):
+		c.Fatal("elect to leader failed after 5s, too slow")
+	}
+
+	masterAddr := fmt.Sprintf("127.0.0.1:%d", testPort[0])
+	err := app.addMasters([]string{masterAddr})
+	c.Assert(err, IsNil)
+
+	ch := s.addBeforeHandler(app)
+
+	app.onSDownVote(sdownVote{Addr: masterAddr, Voter: "node-1"})
+
+	select {
+	case <-ch:
+		c.Fatal("failover ran on a single SDOWN vote with quorum 2")
+	case <-time.After(1 * time.Second):
+	}
+
+	app.onSDownVote(sdownVote{Addr: masterAddr, Voter: "node-2"})
+
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		c.Fatal("failover did not run once quorum was reached")
+	}
+}
+
 func (s *failoverTestSuite) TestMultiFaftFailoverCheck(c *C) {
 	apps := s.newClusterApp(c, 3, 10)
 	defer func() {
@@ -301,6 +465,155 @@ func (s *failoverTestSuite) TestMultiFaftFailoverCheck(c *C) {
 	}
 }
 
+var clusterTestPort = []int{8220, 8221, 8222, 8223, 8224, 8225}
+
+func (s *failoverTestSuite) startClusterRedis(c *C, port int) {
+	checker := &redisChecker{ok: false}
+	cmd := exec.Command("redis-server",
+		"--port", fmt.Sprintf("%d", port),
+		"--save", "",
+		"--cluster-enabled", "yes",
+		"--cluster-config-file", fmt.Sprintf("nodes-%d.conf", port),
+		"--cluster-node-timeout", "2000")
+	cmd.Stdout = checker
+	cmd.Stderr = checker
+
+	err := cmd.Start()
+	c.Assert(err, IsNil)
+
+	for i := 0; i < 20; i++ {
+		var ok bool
+		checker.Lock()
+		ok = checker.ok
+		checker.Unlock()
+
+		if ok {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	c.Fatal("cluster redis-server can not start ok after 10s")
+}
+
+// buildTestCluster boots a 3-shard, 6-node cluster (one replica per
+// shard) on clusterTestPort and waits for it to report cluster_state:ok.
+func (s *failoverTestSuite) buildTestCluster(c *C) {
+	for _, port := range clusterTestPort {
+		s.stopRedis(c, port)
+		os.Remove(fmt.Sprintf("nodes-%d.conf", port))
+		s.startClusterRedis(c, port)
+	}
+
+	first := clusterTestPort[0]
+	for _, port := range clusterTestPort[1:] {
+		s.doCommand(c, first, "CLUSTER", "MEET", "127.0.0.1", port)
+	}
+
+	s.waitClusterNodesKnown(c, len(clusterTestPort))
+
+	slotsPerShard := 16384 / 3
+	masters := []int{clusterTestPort[0], clusterTestPort[2], clusterTestPort[4]}
+	replicas := []int{clusterTestPort[1], clusterTestPort[3], clusterTestPort[5]}
+
+	for i, master := range masters {
+		start := i * slotsPerShard
+		end := start + slotsPerShard - 1
+		if i == len(masters)-1 {
+			end = 16383
+		}
+		args := make([]interface{}, 0, end-start+2)
+		args = append(args, "ADDSLOTS")
+		for slot := start; slot <= end; slot++ {
+			args = append(args, slot)
+		}
+		s.doCommand(c, master, "CLUSTER", args...)
+	}
+
+	for i, replica := range replicas {
+		masterID, err := redis.String(s.doCommand(c, masters[i], "CLUSTER", "MYID"), nil)
+		c.Assert(err, IsNil)
+		s.doCommand(c, replica, "CLUSTER", "REPLICATE", masterID)
+	}
+
+	s.waitClusterStateOK(c, first)
+}
+
+func (s *failoverTestSuite) waitClusterNodesKnown(c *C, n int) {
+	for i := 0; i < 20; i++ {
+		nodes, err := clusterNodes(nil, fmt.Sprintf("127.0.0.1:%d", clusterTestPort[0]))
+		if err == nil && len(nodes) == n {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	c.Fatal("cluster nodes did not converge after 10s")
+}
+
+func (s *failoverTestSuite) waitClusterStateOK(c *C, port int) {
+	for i := 0; i < 20; i++ {
+		v, err := redis.String(s.doCommand(c, port, "CLUSTER", "INFO"), nil)
+		if err == nil && strings.Contains(v, "cluster_state:ok") {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	c.Fatal("cluster did not reach cluster_state:ok after 10s")
+}
+
+func (s *failoverTestSuite) TestClusterShardFailover(c *C) {
+	s.buildTestCluster(c)
+	defer func() {
+		for _, port := range clusterTestPort {
+			s.stopRedis(c, port)
+			os.Remove(fmt.Sprintf("nodes-%d.conf", port))
+		}
+	}()
+
+	cfg := new(Config)
+	cfg.Addr = ":11000"
+	cfg.Mode = ModeCluster
+	cfg.Masters = []string{fmt.Sprintf("127.0.0.1:%d", clusterTestPort[0])}
+	cfg.CheckInterval = 500
+	cfg.DownAfter = time.Second
+
+	app, err := NewApp(cfg)
+	c.Assert(err, IsNil)
+	defer app.Close()
+
+	go func() {
+		app.Run()
+	}()
+
+	// let the checker discover the full topology before killing anything
+	time.Sleep(2 * time.Second)
+
+	downMaster := fmt.Sprintf("127.0.0.1:%d", clusterTestPort[0])
+
+	app.RLock()
+	shard := app.shardsByMaster[downMaster]
+	app.RUnlock()
+	c.Assert(shard, NotNil)
+
+	ch := make(chan string, 1)
+	app.AddShardAfterFailoverHandler(func(shardID, oldMaster, newMaster string) error {
+		if oldMaster == downMaster {
+			ch <- newMaster
+		}
+		return nil
+	})
+
+	s.stopRedis(c, clusterTestPort[0])
+
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		c.Fatal("shard failover is not ok after 10s, too slow")
+	}
+}
+
 func (s *failoverTestSuite) addBeforeHandler(app *App) chan string {
 	ch := make(chan string, 1)
 	f := func(downMaster string) error {
@@ -345,6 +658,8 @@ func (s *failoverTestSuite) newClusterApp(c *C, num int, base int) []*App {
 		cfg.Raft.ClusterState = ClusterStateExisting
 		cfg.Raft.Cluster = cluster
 
+		cfg.DownAfter = time.Second
+
 		app, err := NewApp(cfg)
 
 		c.Assert(err, IsNil)
@@ -398,6 +713,167 @@ func (s *failoverTestSuite) waitReplConnected(c *C, port int, timeout int) {
 	c.Fatalf("wait %ds, but 127.0.0.1:%d can not connect to master", timeout, port)
 }
 
+// authTLSTestPort and authTLSReplicaPort are a master/replica pair of
+// redis-server instances started on demand by TestAuthAndTLS, separate
+// from testPort since they need requirepass, masterauth and TLS flags
+// the other tests don't want.
+const authTLSTestPort = 16390
+const authTLSReplicaPort = 16391
+
+func (s *failoverTestSuite) startAuthTLSRedis(c *C, certDir string, port int) bool {
+	checker := &redisChecker{ok: false}
+	cmd := exec.Command("redis-server",
+		"--port", "0",
+		"--tls-port", fmt.Sprintf("%d", port),
+		"--tls-cert-file", fmt.Sprintf("%s/redis.crt", certDir),
+		"--tls-key-file", fmt.Sprintf("%s/redis.key", certDir),
+		"--tls-ca-cert-file", fmt.Sprintf("%s/ca.crt", certDir),
+		"--tls-auth-clients", "no",
+		"--tls-replication", "yes",
+		"--requirepass", "s3cret",
+		"--masterauth", "s3cret",
+		"--save", "",
+	)
+	cmd.Stdout = checker
+	cmd.Stderr = checker
+
+	if err := cmd.Start(); err != nil {
+		return false
+	}
+
+	for i := 0; i < 20; i++ {
+		var ok bool
+		checker.Lock()
+		ok = checker.ok
+		checker.Unlock()
+
+		if ok {
+			return true
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return false
+}
+
+func (s *failoverTestSuite) stopAuthTLSRedis(certDir string, port int) {
+	exec.Command("redis-cli", "--tls",
+		"--cert", certDir+"/redis.crt", "--key", certDir+"/redis.key", "--cacert", certDir+"/ca.crt",
+		"-p", fmt.Sprintf("%d", port), "-a", "s3cret", "--no-auth-warning",
+		"shutdown", "nosave").Run()
+}
+
+// waitAuthTLSReplConnected polls INFO over the TLS+AUTH dial path,
+// since authTLSReplicaPort has no plain port for s.doCommand to use.
+func (s *failoverTestSuite) waitAuthTLSReplConnected(c *C, cfg *RedisConfig, addr string, timeout int) {
+	for i := 0; i < timeout*2; i++ {
+		info, err := fetchInfo(cfg, addr)
+		if err == nil && info["role"] == SlaveType && info["master_link_status"] == "up" {
+			return
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	c.Fatalf("wait %ds, but %s can not connect to master over TLS", timeout, addr)
+}
+
+// TestAuthAndTLS exercises the TLS dial and AUTH path against a
+// redis-server started with --requirepass and --tls-port, then builds
+// a real master/replica pair behind those same credentials and drives
+// an end-to-end failover through App/checkMaster/doElect/failover, the
+// same way the plaintext tests do, to prove the TLS+AUTH config is
+// actually threaded through the promotion path and not just the dial
+// helper. It skips itself rather than failing when openssl or a
+// TLS-capable redis-server aren't available, since most CI/dev images
+// don't ship either.
+func (s *failoverTestSuite) TestAuthAndTLS(c *C) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		c.Skip("openssl not found")
+	}
+
+	certDir := c.MkDir()
+
+	genKey := func(name string, args ...string) {
+		cmd := exec.Command("openssl", args...)
+		out, err := cmd.CombinedOutput()
+		c.Assert(err, IsNil, Commentf("%s: %s", name, out))
+	}
+
+	genKey("ca key", "genrsa", "-out", certDir+"/ca.key", "2048")
+	genKey("ca cert", "req", "-x509", "-new", "-nodes", "-key", certDir+"/ca.key",
+		"-days", "1", "-subj", "/CN=test-ca", "-out", certDir+"/ca.crt")
+	genKey("redis key", "genrsa", "-out", certDir+"/redis.key", "2048")
+	genKey("redis csr", "req", "-new", "-key", certDir+"/redis.key",
+		"-subj", "/CN=127.0.0.1", "-out", certDir+"/redis.csr")
+	genKey("redis cert", "x509", "-req", "-in", certDir+"/redis.csr",
+		"-CA", certDir+"/ca.crt", "-CAkey", certDir+"/ca.key", "-CAcreateserial",
+		"-days", "1", "-out", certDir+"/redis.crt")
+
+	if !s.startAuthTLSRedis(c, certDir, authTLSTestPort) {
+		c.Skip("redis-server does not support --tls-port")
+	}
+	defer s.stopAuthTLSRedis(certDir, authTLSTestPort)
+
+	masterAddr := fmt.Sprintf("127.0.0.1:%d", authTLSTestPort)
+	cfg := &RedisConfig{
+		Password: "s3cret",
+		TLS: TLSConfig{
+			CAFile:     certDir + "/ca.crt",
+			ServerName: "127.0.0.1",
+		},
+	}
+
+	c.Assert(ping(cfg, masterAddr), IsNil)
+
+	info, err := fetchInfo(cfg, masterAddr)
+	c.Assert(err, IsNil)
+	c.Assert(info["run_id"], Not(Equals), "")
+
+	_, err = doCommand(nil, masterAddr, "PING")
+	c.Assert(err, NotNil)
+
+	// Now prove the same credentials work end to end through App: a
+	// replica behind the identical TLS+AUTH config, a real checkMaster
+	// loop, and a promotion once the master is killed.
+	if !s.startAuthTLSRedis(c, certDir, authTLSReplicaPort) {
+		c.Skip("redis-server does not support --tls-port")
+	}
+	defer s.stopAuthTLSRedis(certDir, authTLSReplicaPort)
+
+	replicaAddr := fmt.Sprintf("127.0.0.1:%d", authTLSReplicaPort)
+
+	_, err = doCommand(cfg, replicaAddr, "SLAVEOF", "127.0.0.1", fmt.Sprintf("%d", authTLSTestPort))
+	c.Assert(err, IsNil)
+	s.waitAuthTLSReplConnected(c, cfg, replicaAddr, 10)
+
+	appCfg := new(Config)
+	appCfg.Addr = ":11000"
+	appCfg.Masters = []string{masterAddr}
+	appCfg.CheckInterval = 500
+	appCfg.DownAfter = time.Second
+	appCfg.Redis = *cfg
+
+	app, err := NewApp(appCfg)
+	c.Assert(err, IsNil)
+	defer app.Close()
+
+	ch := s.addAfterHandler(app)
+
+	go func() {
+		app.Run()
+	}()
+
+	s.stopAuthTLSRedis(certDir, authTLSTestPort)
+
+	select {
+	case newMaster := <-ch:
+		c.Assert(newMaster, Equals, replicaAddr)
+	case <-time.After(10 * time.Second):
+		c.Fatal("TLS+AUTH failover is not ok after 10s, too slow")
+	}
+}
+
 func (s *failoverTestSuite) waitSync(c *C, port int, timeout int) {
 	g := newGroup(fmt.Sprintf("127.0.0.1:%d", port))
 
@@ -423,4 +899,200 @@ func (s *failoverTestSuite) waitSync(c *C, port int, timeout int) {
 	}
 
 	c.Fatalf("wait %ds, but all slaves can not sync the same with master %v", timeout, g)
-}
\ No newline at end of file
+}
+
+// waitGroup waits until checkMasters has populated app.groups[addr]
+// with a group reporting numSlaves slaves, the same data sentinelSlaves
+// reads from.
+func (s *failoverTestSuite) waitGroup(c *C, app *App, addr string, numSlaves int, timeout int) {
+	for i := 0; i < timeout*2; i++ {
+		app.RLock()
+		g := app.groups[addr]
+		app.RUnlock()
+
+		if g != nil && len(g.Slaves) == numSlaves {
+			return
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	c.Fatalf("wait %ds, but %s never got a group with %d slaves", timeout, addr, numSlaves)
+}
+
+// TestReadRESPCommandRejectsMalformedSizes checks that a negative
+// multibulk count or bulk-string length is rejected with an error
+// instead of being fed straight into make(), which would panic with
+// "cap out of range" and crash handleConn's goroutine.
+func (s *failoverTestSuite) TestReadRESPCommandRejectsMalformedSizes(c *C) {
+	_, err := readRESPCommand(bufio.NewReader(bytes.NewBufferString("*-2\r\n")))
+	c.Assert(err, NotNil)
+
+	_, err = readRESPCommand(bufio.NewReader(bytes.NewBufferString("*1\r\n$-5\r\n")))
+	c.Assert(err, NotNil)
+}
+
+// TestSentinelRESPListener exercises the admin/RESP listener end to
+// end, the way an unmodified Sentinel-aware client would: dial it,
+// resolve a group through SENTINEL GET-MASTER-ADDR-BY-NAME and SENTINEL
+// SLAVES, subscribe to the Sentinel hello channel, then drive a real
+// failover and confirm a +switch-master is pushed to the subscriber.
+func (s *failoverTestSuite) TestSentinelRESPListener(c *C) {
+	cfg := new(Config)
+	cfg.Addr = ":11000"
+
+	port := testPort[0]
+	masterAddr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	cfg.Masters = []string{masterAddr}
+	cfg.Groups = []MasterGroup{{Name: "mymaster", Addr: masterAddr}}
+	cfg.CheckInterval = 500
+	cfg.DownAfter = time.Second
+
+	app, err := NewApp(cfg)
+	c.Assert(err, IsNil)
+	defer app.Close()
+
+	go func() {
+		app.Run()
+	}()
+
+	s.buildReplTopo(c)
+	s.waitGroup(c, app, masterAddr, 2, 10)
+
+	conn, err := redis.Dial("tcp", "127.0.0.1:11000")
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	addr, err := redis.Strings(conn.Do("SENTINEL", "GET-MASTER-ADDR-BY-NAME", "mymaster"))
+	c.Assert(err, IsNil)
+	c.Assert(addr, DeepEquals, []string{"127.0.0.1", fmt.Sprintf("%d", port)})
+
+	slaves, err := redis.Values(conn.Do("SENTINEL", "SLAVES", "mymaster"))
+	c.Assert(err, IsNil)
+	c.Assert(slaves, HasLen, 2)
+
+	for _, raw := range slaves {
+		fields, err := redis.Strings(raw, nil)
+		c.Assert(err, IsNil)
+
+		m := make(map[string]string, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			m[fields[i]] = fields[i+1]
+		}
+
+		c.Assert(m["master-host"], Equals, "127.0.0.1")
+		c.Assert(m["master-port"], Equals, fmt.Sprintf("%d", port))
+	}
+
+	subConn, err := redis.Dial("tcp", "127.0.0.1:11000")
+	c.Assert(err, IsNil)
+	defer subConn.Close()
+
+	c.Assert(subConn.Send("SUBSCRIBE", SwitchMasterChannel), IsNil)
+	c.Assert(subConn.Flush(), IsNil)
+
+	ack, err := redis.Strings(subConn.Receive())
+	c.Assert(err, IsNil)
+	c.Assert(ack, DeepEquals, []string{"subscribe", SwitchMasterChannel})
+
+	msgCh := make(chan []string, 1)
+	go func() {
+		reply, err := redis.Strings(subConn.Receive())
+		if err == nil {
+			msgCh <- reply
+		}
+	}()
+
+	s.stopRedis(c, port)
+
+	select {
+	case reply := <-msgCh:
+		c.Assert(reply, HasLen, 3)
+		c.Assert(reply[0], Equals, "message")
+		c.Assert(reply[1], Equals, SwitchMasterChannel)
+		c.Assert(strings.HasPrefix(reply[2], "+switch-master mymaster "), Equals, true)
+	case <-time.After(10 * time.Second):
+		c.Fatal("did not receive +switch-master push after 10s")
+	}
+}
+
+// shardingBenchMembers and shardingBenchMasters back both
+// TestHealthCheckShardingBalance and BenchmarkHealthCheckSharding so the
+// two exercise the exact same ring.
+var shardingBenchMembers = []string{"127.0.0.1:7001", "127.0.0.1:7002", "127.0.0.1:7003"}
+
+func shardingBenchMasters() []string {
+	masters := make([]string, 500)
+	for i := range masters {
+		masters[i] = fmt.Sprintf("127.0.0.1:%d", 20000+i)
+	}
+	return masters
+}
+
+func newShardingBenchApps(members []string) []*App {
+	apps := make([]*App, len(members))
+	for i, addr := range members {
+		apps[i] = &App{
+			cfg: &Config{CheckSharding: true, Raft: RaftConfig{Addr: addr, Cluster: members}},
+			r:   &Raft{cfg: RaftConfig{Cluster: members}},
+		}
+		apps[i].rebuildRing()
+	}
+	return apps
+}
+
+// TestHealthCheckShardingBalance registers 500 fake masters against
+// three CheckSharding-enabled apps sharing one raft member list, and
+// asserts checkMasters' own ownership filter (app.owns, fed by
+// app.rebuildRing) spreads the probing load within +/-10% across them.
+// It uses bare App/Raft structs rather than NewApp/newRaft so it
+// exercises the sharding layer itself without paying for a real raft
+// cluster's startup cost.
+func (s *failoverTestSuite) TestHealthCheckShardingBalance(c *C) {
+	members := shardingBenchMembers
+	masters := shardingBenchMasters()
+	apps := newShardingBenchApps(members)
+
+	counts := make([]int64, len(members))
+	for i, app := range apps {
+		for _, addr := range masters {
+			if app.cfg.CheckSharding && app.owns(addr) {
+				counts[i]++
+			}
+		}
+	}
+
+	total := int64(0)
+	for _, n := range counts {
+		total += n
+	}
+
+	want := total / int64(len(members))
+	tolerance := want / 10
+
+	for i, got := range counts {
+		c.Assert(got >= want-tolerance && got <= want+tolerance, Equals, true,
+			Commentf("app %s probed %d masters, want %d +/- %d", members[i], got, want, tolerance))
+	}
+}
+
+// BenchmarkHealthCheckSharding measures the throughput of the same
+// ownership filter TestHealthCheckShardingBalance asserts is balanced.
+func BenchmarkHealthCheckSharding(b *testing.B) {
+	members := shardingBenchMembers
+	masters := shardingBenchMasters()
+	apps := newShardingBenchApps(members)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, app := range apps {
+			for _, addr := range masters {
+				_ = app.cfg.CheckSharding && app.owns(addr)
+			}
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(b.N*len(masters)*len(apps))/b.Elapsed().Seconds(), "probes/sec")
+}
@@ -0,0 +1,151 @@
+package failover
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// MasterInfo describes a group's master as reported by its own ROLE
+// command.
+type MasterInfo struct {
+	Addr   string
+	Offset int64
+}
+
+// SlaveInfo describes a single replica of a group's master. Offset
+// comes from the master's own ROLE reply; RunID, LinkStatus and
+// LinkDownFor come from the slave's own INFO and are filled in by
+// refreshHealth, not by doRole.
+type SlaveInfo struct {
+	Addr   string
+	Offset int64
+
+	RunID       string
+	LinkStatus  string
+	LinkDownFor time.Duration
+	Priority    int
+}
+
+// Group is a master and the slaves replicating from it, as seen from a
+// single ROLE call against the master.
+type Group struct {
+	Addr string
+
+	// cfg is the dial configuration used for every ROLE/INFO call
+	// against this group's master and slaves. It is nil for groups
+	// built directly with newGroup, which dials plaintext with no
+	// credentials; App-driven call sites set it with app.redisConfigFor
+	// right after construction.
+	cfg *RedisConfig
+
+	Master *MasterInfo
+	Slaves []*SlaveInfo
+}
+
+func newGroup(addr string) *Group {
+	return &Group{Addr: addr}
+}
+
+// doRole issues ROLE against the group's address and refreshes Master
+// and Slaves from the reply. addr is expected to be a master; if it
+// isn't, ROLE will report role "slave" and doRole returns an error.
+func (g *Group) doRole() error {
+	reply, err := doCommand(g.cfg, g.Addr, "ROLE")
+	if err != nil {
+		return err
+	}
+
+	v, err := redis.Values(reply, nil)
+	if err != nil {
+		return err
+	}
+
+	role, err := redis.String(v[0], nil)
+	if err != nil {
+		return err
+	}
+
+	if role != MasterType {
+		return fmt.Errorf("failover: %s is not a master, role %s", g.Addr, role)
+	}
+
+	offset, err := redis.Int64(v[1], nil)
+	if err != nil {
+		return err
+	}
+
+	slaveRows, err := redis.Values(v[2], nil)
+	if err != nil {
+		return err
+	}
+
+	slaves := make([]*SlaveInfo, 0, len(slaveRows))
+	for _, row := range slaveRows {
+		fields, err := redis.Values(row, nil)
+		if err != nil {
+			return err
+		}
+
+		ip, err := redis.String(fields[0], nil)
+		if err != nil {
+			return err
+		}
+
+		port, err := redis.String(fields[1], nil)
+		if err != nil {
+			return err
+		}
+
+		offsetStr, err := redis.String(fields[2], nil)
+		if err != nil {
+			return err
+		}
+
+		slaveOffset, err := strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		slaves = append(slaves, &SlaveInfo{
+			Addr:   fmt.Sprintf("%s:%s", ip, port),
+			Offset: slaveOffset,
+		})
+	}
+
+	g.Master = &MasterInfo{Addr: g.Addr, Offset: offset}
+	g.Slaves = slaves
+
+	return nil
+}
+
+// refreshHealth fills in the parts of each SlaveInfo that doRole cannot
+// see: the slave's own run id and replication link status, plus the
+// configured promotion priority and how long the link has been down,
+// both tracked by app. It is best-effort: a slave that cannot be
+// reached for INFO is recorded with link status "down" and its down
+// time tracked, the same as a slave that reports its link down.
+func (g *Group) refreshHealth(app *App) {
+	for _, sl := range g.Slaves {
+		sl.Priority = app.masters.Priority(sl.Addr)
+
+		info, err := fetchInfo(app.redisConfigFor(sl.Addr), sl.Addr)
+		if err != nil {
+			sl.LinkStatus = "down"
+			sl.LinkDownFor = app.markSlaveLinkDown(sl.Addr)
+			continue
+		}
+
+		sl.RunID = info["run_id"]
+		sl.LinkStatus = info["master_link_status"]
+
+		if sl.LinkStatus == "down" {
+			sl.LinkDownFor = app.markSlaveLinkDown(sl.Addr)
+		} else {
+			app.clearSlaveLinkDown(sl.Addr)
+			sl.LinkDownFor = 0
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package failover
+
+import "github.com/ngaut/log"
+
+// BeforeFailoverHandler is called right after a master has been detected
+// down, before any election or promotion happens.
+type BeforeFailoverHandler func(downMaster string) error
+
+// AfterFailoverHandler is called once a new master has been promoted in
+// place of a failed one.
+type AfterFailoverHandler func(oldMaster string, newMaster string) error
+
+// ShardBeforeFailoverHandler is the ModeCluster counterpart of
+// BeforeFailoverHandler: it additionally carries the shard's ID, the
+// cluster node ID of the master that went down.
+type ShardBeforeFailoverHandler func(shardID string, downMaster string) error
+
+// ShardAfterFailoverHandler is the ModeCluster counterpart of
+// AfterFailoverHandler, additionally carrying the shard's ID.
+type ShardAfterFailoverHandler func(shardID string, oldMaster string, newMaster string) error
+
+// AddBeforeFailoverHandler registers f to be called whenever a monitored
+// master is detected down.
+func (app *App) AddBeforeFailoverHandler(f BeforeFailoverHandler) {
+	app.Lock()
+	defer app.Unlock()
+
+	app.beforeHandlers = append(app.beforeHandlers, f)
+}
+
+// AddAfterFailoverHandler registers f to be called whenever a new master
+// has been promoted.
+func (app *App) AddAfterFailoverHandler(f AfterFailoverHandler) {
+	app.Lock()
+	defer app.Unlock()
+
+	app.afterHandlers = append(app.afterHandlers, f)
+}
+
+// AddShardBeforeFailoverHandler registers f to be called, in
+// ModeCluster, whenever a shard's master is detected down.
+func (app *App) AddShardBeforeFailoverHandler(f ShardBeforeFailoverHandler) {
+	app.Lock()
+	defer app.Unlock()
+
+	app.shardBeforeHandlers = append(app.shardBeforeHandlers, f)
+}
+
+// AddShardAfterFailoverHandler registers f to be called, in
+// ModeCluster, whenever this node promotes a shard's replica, and
+// whenever a known shard ID is seen at a new master address. A replica
+// that Redis Cluster promotes on its own shows up as a new shard and
+// does not call f.
+func (app *App) AddShardAfterFailoverHandler(f ShardAfterFailoverHandler) {
+	app.Lock()
+	defer app.Unlock()
+
+	app.shardAfterHandlers = append(app.shardAfterHandlers, f)
+}
+
+func (app *App) runShardBeforeHandlers(shardID, downMaster string) {
+	app.RLock()
+	handlers := app.shardBeforeHandlers
+	app.RUnlock()
+
+	for _, f := range handlers {
+		if err := f(shardID, downMaster); err != nil {
+			log.Errorf("run shard before failover handler for %s/%s err %v", shardID, downMaster, err)
+		}
+	}
+}
+
+func (app *App) runShardAfterHandlers(shardID, oldMaster, newMaster string) {
+	app.RLock()
+	handlers := app.shardAfterHandlers
+	app.RUnlock()
+
+	for _, f := range handlers {
+		if err := f(shardID, oldMaster, newMaster); err != nil {
+			log.Errorf("run shard after failover handler for %s/%s -> %s err %v", shardID, oldMaster, newMaster, err)
+		}
+	}
+}
+
+func (app *App) runBeforeHandlers(downMaster string) {
+	app.RLock()
+	handlers := app.beforeHandlers
+	app.RUnlock()
+
+	for _, f := range handlers {
+		if err := f(downMaster); err != nil {
+			log.Errorf("run before failover handler for %s err %v", downMaster, err)
+		}
+	}
+}
+
+func (app *App) runAfterHandlers(oldMaster string, newMaster string) {
+	app.RLock()
+	handlers := app.afterHandlers
+	app.RUnlock()
+
+	for _, f := range handlers {
+		if err := f(oldMaster, newMaster); err != nil {
+			log.Errorf("run after failover handler for %s -> %s err %v", oldMaster, newMaster, err)
+		}
+	}
+}
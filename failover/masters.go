@@ -0,0 +1,249 @@
+package failover
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/raft"
+)
+
+type mastersCmdType int
+
+const (
+	cmdAddMasters mastersCmdType = iota + 1
+	cmdRemoveMaster
+	cmdSetMasterName
+	cmdSetSlavePriority
+)
+
+// defaultSlavePriority matches Redis's own slave-priority default: every
+// slave is equally eligible for promotion unless told otherwise.
+const defaultSlavePriority = 100
+
+type mastersCmd struct {
+	Type  mastersCmdType
+	Addrs []string
+
+	// Addr is used by cmdSetMasterName and cmdSetSlavePriority; Name
+	// only by cmdSetMasterName.
+	Addr string
+	Name string
+
+	// Priority is only used by cmdSetSlavePriority, keyed by Addr above.
+	Priority int
+}
+
+// MasterGroupInfo describes a monitored master by its logical name, the
+// name clients use with SENTINEL rather than its address.
+type MasterGroupInfo struct {
+	Name string
+	Addr string
+}
+
+// Masters is the raft FSM that keeps the set of currently monitored
+// masters consistent across every node in the cluster. Only the leader
+// proposes changes, but every node applies them so GetMasters() always
+// reflects the agreed-upon state.
+//
+// Besides the address set, it tracks an optional logical name per
+// master so Sentinel-style clients can address a group by name (e.g.
+// "SENTINEL get-master-addr-by-name mymaster") instead of by the
+// address that happens to be master right now.
+type Masters struct {
+	sync.RWMutex
+
+	addrs      map[string]struct{}
+	names      map[string]string // addr -> name
+	priorities map[string]int    // slave addr -> slave-priority
+}
+
+func newMasters() *Masters {
+	return &Masters{
+		addrs:      make(map[string]struct{}),
+		names:      make(map[string]string),
+		priorities: make(map[string]int),
+	}
+}
+
+// Priority returns the configured promotion priority for a slave
+// address, the same way Redis's own slave-priority works: lower values
+// are preferred, and 0 means the slave must never be promoted. A slave
+// with no priority ever set reports defaultSlavePriority.
+func (m *Masters) Priority(addr string) int {
+	m.RLock()
+	defer m.RUnlock()
+
+	if p, ok := m.priorities[addr]; ok {
+		return p
+	}
+
+	return defaultSlavePriority
+}
+
+// GetMasters returns the sorted list of currently monitored masters.
+func (m *Masters) GetMasters() []string {
+	m.RLock()
+	defer m.RUnlock()
+
+	addrs := make([]string, 0, len(m.addrs))
+	for addr := range m.addrs {
+		addrs = append(addrs, addr)
+	}
+
+	sort.Strings(addrs)
+	return addrs
+}
+
+// GetGroups returns every monitored master paired with its logical
+// name. A master with no explicit name reports itself as its own name.
+func (m *Masters) GetGroups() []MasterGroupInfo {
+	m.RLock()
+	defer m.RUnlock()
+
+	groups := make([]MasterGroupInfo, 0, len(m.addrs))
+	for addr := range m.addrs {
+		groups = append(groups, MasterGroupInfo{Name: m.nameOf(addr), Addr: addr})
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// GetAddrByName returns the address currently backing the master group
+// called name.
+func (m *Masters) GetAddrByName(name string) (string, bool) {
+	m.RLock()
+	defer m.RUnlock()
+
+	for addr := range m.addrs {
+		if m.nameOf(addr) == name {
+			return addr, true
+		}
+	}
+
+	return "", false
+}
+
+// Name returns the logical name for addr, falling back to the address
+// itself when no name was ever assigned.
+func (m *Masters) Name(addr string) string {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.nameOf(addr)
+}
+
+// nameOf returns the logical name for addr, falling back to the address
+// itself when no name was ever assigned. Callers must hold m's lock.
+func (m *Masters) nameOf(addr string) string {
+	if name, ok := m.names[addr]; ok {
+		return name
+	}
+
+	return addr
+}
+
+func (m *Masters) Apply(log *raft.Log) interface{} {
+	cmd := new(mastersCmd)
+	if err := json.Unmarshal(log.Data, cmd); err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	switch cmd.Type {
+	case cmdAddMasters:
+		for _, addr := range cmd.Addrs {
+			m.addrs[addr] = struct{}{}
+		}
+	case cmdRemoveMaster:
+		for _, addr := range cmd.Addrs {
+			delete(m.addrs, addr)
+			delete(m.names, addr)
+		}
+	case cmdSetMasterName:
+		m.names[cmd.Addr] = cmd.Name
+	case cmdSetSlavePriority:
+		m.priorities[cmd.Addr] = cmd.Priority
+	}
+
+	return nil
+}
+
+func (m *Masters) Snapshot() (raft.FSMSnapshot, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	addrs := make([]string, 0, len(m.addrs))
+	for addr := range m.addrs {
+		addrs = append(addrs, addr)
+	}
+
+	names := make(map[string]string, len(m.names))
+	for addr, name := range m.names {
+		names[addr] = name
+	}
+
+	priorities := make(map[string]int, len(m.priorities))
+	for addr, p := range m.priorities {
+		priorities[addr] = p
+	}
+
+	return &mastersSnapshot{Addrs: addrs, Names: names, Priorities: priorities}, nil
+}
+
+func (m *Masters) Restore(r io.ReadCloser) error {
+	defer r.Close()
+
+	var state mastersSnapshot
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.addrs = make(map[string]struct{}, len(state.Addrs))
+	for _, addr := range state.Addrs {
+		m.addrs[addr] = struct{}{}
+	}
+
+	m.names = state.Names
+	if m.names == nil {
+		m.names = make(map[string]string)
+	}
+
+	m.priorities = state.Priorities
+	if m.priorities == nil {
+		m.priorities = make(map[string]int)
+	}
+
+	return nil
+}
+
+type mastersSnapshot struct {
+	Addrs      []string
+	Names      map[string]string
+	Priorities map[string]int
+}
+
+func (s *mastersSnapshot) Persist(sink raft.SnapshotSink) error {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	if _, err := io.Copy(sink, bytes.NewReader(buf)); err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func (s *mastersSnapshot) Release() {}
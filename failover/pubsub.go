@@ -0,0 +1,91 @@
+package failover
+
+import (
+	"bufio"
+	"fmt"
+	"sync"
+)
+
+// SwitchMasterChannel is the pub/sub channel real Sentinel publishes
+// switch-master events on; go-redis's failover client and other
+// Sentinel-aware clients already know to subscribe to it to invalidate
+// their cached master. It is distinct from __sentinel__:hello, which
+// only ever carries periodic Sentinel-to-Sentinel gossip, not events.
+const SwitchMasterChannel = "+switch-master"
+
+// subscriber is a client that has SUBSCRIBEd to one or more channels on
+// the admin/RESP listener.
+type subscriber struct {
+	mu sync.Mutex
+	bw *bufio.Writer
+}
+
+func (s *subscriber) send(channel, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeStringArray(s.bw, []string{"message", channel, message})
+	return s.bw.Flush()
+}
+
+// pubsub fans published messages out to every subscriber of a channel.
+type pubsub struct {
+	sync.RWMutex
+
+	subs map[string]map[*subscriber]struct{}
+}
+
+func newPubSub() *pubsub {
+	return &pubsub{subs: make(map[string]map[*subscriber]struct{})}
+}
+
+func (p *pubsub) subscribe(channel string, sub *subscriber) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.subs[channel] == nil {
+		p.subs[channel] = make(map[*subscriber]struct{})
+	}
+	p.subs[channel][sub] = struct{}{}
+}
+
+func (p *pubsub) unsubscribeAll(sub *subscriber) {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, subs := range p.subs {
+		delete(subs, sub)
+	}
+}
+
+// publish delivers message to every current subscriber of channel and
+// returns how many of them received it.
+func (p *pubsub) publish(channel, message string) int {
+	p.RLock()
+	subs := make([]*subscriber, 0, len(p.subs[channel]))
+	for sub := range p.subs[channel] {
+		subs = append(subs, sub)
+	}
+	p.RUnlock()
+
+	n := 0
+	for _, sub := range subs {
+		if err := sub.send(channel, message); err == nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+// publishSwitchMaster announces a completed promotion in the same
+// format real Sentinel uses, so unmodified Sentinel-aware clients can
+// invalidate their cached master without understanding anything else
+// about this module.
+func (app *App) publishSwitchMaster(name, oldAddr, newAddr string) {
+	oldHost, oldPort := splitHostPort(oldAddr)
+	newHost, newPort := splitHostPort(newAddr)
+
+	msg := fmt.Sprintf("+switch-master %s %s %s %s %s", name, oldHost, oldPort, newHost, newPort)
+	app.pubsub.publish(SwitchMasterChannel, msg)
+}
@@ -0,0 +1,138 @@
+package failover
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/raft-boltdb"
+)
+
+// Raft wraps hashicorp/raft so the rest of the module only has to deal
+// with the small surface it actually needs: applying FSM commands and
+// knowing whether this node is currently the leader.
+type Raft struct {
+	cfg RaftConfig
+
+	r     *raft.Raft
+	fsm   raft.FSM
+	trans *raft.NetworkTransport
+
+	leaderCh chan bool
+}
+
+func newRaft(cfg RaftConfig, fsm raft.FSM) (*Raft, error) {
+	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.LogDir, 0755); err != nil {
+		return nil, err
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	trans, err := raft.NewTCPTransport(cfg.Addr, addr, 3, 10*time.Second, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	logStore, err := raftboltdb.NewBoltStore(fmt.Sprintf("%s/raft-log.db", cfg.LogDir))
+	if err != nil {
+		return nil, err
+	}
+
+	stableStore, err := raftboltdb.NewBoltStore(fmt.Sprintf("%s/raft-stable.db", cfg.LogDir))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotStore, err := raft.NewFileSnapshotStore(cfg.DataDir, 1, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	peerStore := raft.NewJSONPeers(cfg.DataDir, trans)
+
+	if cfg.ClusterState == ClusterStateNew {
+		if err := peerStore.SetPeers(cfg.Cluster); err != nil {
+			return nil, err
+		}
+	}
+
+	conf := raft.DefaultConfig()
+	conf.EnableSingleNode = len(cfg.Cluster) <= 1
+
+	r, err := raft.NewRaft(conf, fsm, logStore, stableStore, snapshotStore, peerStore, trans)
+	if err != nil {
+		return nil, err
+	}
+
+	ra := &Raft{
+		cfg:      cfg,
+		r:        r,
+		fsm:      fsm,
+		trans:    trans,
+		leaderCh: make(chan bool, 1),
+	}
+
+	go ra.runObserve()
+
+	return ra, nil
+}
+
+func (r *Raft) runObserve() {
+	for b := range r.r.LeaderCh() {
+		select {
+		case r.leaderCh <- b:
+		default:
+		}
+	}
+}
+
+// LeaderCh notifies on every leadership change of this node.
+func (r *Raft) LeaderCh() <-chan bool {
+	return r.leaderCh
+}
+
+// IsLeader returns whether this node currently believes itself to be the
+// raft leader.
+func (r *Raft) IsLeader() bool {
+	return r.r.State() == raft.Leader
+}
+
+// Peers returns the full set of raft peer addresses this node was
+// configured with. The module has no add/remove-peer command, so this
+// is effectively fixed for the process's lifetime.
+func (r *Raft) Peers() []string {
+	if len(r.cfg.Cluster) > 0 {
+		return r.cfg.Cluster
+	}
+
+	return []string{r.cfg.Addr}
+}
+
+// Apply proposes cmd to the raft log and waits for it to be committed.
+func (r *Raft) Apply(cmd []byte, timeout time.Duration) error {
+	f := r.r.Apply(cmd, timeout)
+	return f.Error()
+}
+
+// Barrier blocks until all raft log entries applied so far have been
+// applied to the local FSM.
+func (r *Raft) Barrier(timeout time.Duration) error {
+	f := r.r.Barrier(timeout)
+	return f.Error()
+}
+
+func (r *Raft) Close() error {
+	f := r.r.Shutdown()
+	if err := f.Error(); err != nil {
+		return err
+	}
+	return r.trans.Close()
+}
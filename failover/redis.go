@@ -0,0 +1,152 @@
+package failover
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const dialTimeout = 5 * time.Second
+
+// dial opens a connection to the redis instance at addr, using cfg's
+// TLS and AUTH settings. A nil cfg dials plaintext with no credentials,
+// the module's original behavior; every App-driven call site instead
+// passes app.redisConfigFor(addr).
+func dial(cfg *RedisConfig, addr string) (redis.Conn, error) {
+	var conn redis.Conn
+	var err error
+
+	if cfg != nil && cfg.TLS.enabled() {
+		conn, err = dialTLS(cfg, addr)
+	} else {
+		conn, err = redis.DialTimeout("tcp", addr, dialTimeout, dialTimeout, dialTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return authConn(conn, cfg)
+}
+
+func dialTLS(cfg *RedisConfig, addr string) (redis.Conn, error) {
+	tlsConf := &tls.Config{
+		ServerName:         cfg.TLS.ServerName,
+		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+	}
+
+	if cfg.TLS.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.TLS.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failover: %s contains no usable CA certificate", cfg.TLS.CAFile)
+		}
+		tlsConf.RootCAs = pool
+	}
+
+	if cfg.TLS.CertFile != "" && cfg.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+
+	netConn, err := tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", addr, tlsConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return redis.NewConn(netConn, dialTimeout, dialTimeout), nil
+}
+
+// authConn issues AUTH against conn if cfg carries credentials, closing
+// and returning the error if it fails.
+func authConn(conn redis.Conn, cfg *RedisConfig) (redis.Conn, error) {
+	if cfg == nil || cfg.Password == "" {
+		return conn, nil
+	}
+
+	var err error
+	if cfg.Username != "" {
+		_, err = conn.Do("AUTH", cfg.Username, cfg.Password)
+	} else {
+		_, err = conn.Do("AUTH", cfg.Password)
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// doCommand opens a short-lived connection to addr and runs a single
+// command against it. It is only meant for the occasional admin/health
+// check call; hot paths should keep their own connection around.
+func doCommand(cfg *RedisConfig, addr string, cmd string, args ...interface{}) (interface{}, error) {
+	conn, err := dial(cfg, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.Do(cmd, args...)
+}
+
+func ping(cfg *RedisConfig, addr string) error {
+	_, err := doCommand(cfg, addr, "PING")
+	return err
+}
+
+// fetchInfo runs INFO against addr and parses the usual "key:value"
+// lines redis replies with into a map. Comment lines (starting with
+// '#') and blank lines are skipped.
+func fetchInfo(cfg *RedisConfig, addr string) (map[string]string, error) {
+	reply, err := doCommand(cfg, addr, "INFO")
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := redis.String(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	info := make(map[string]string)
+	for _, line := range strings.Split(raw, "\r\n") {
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		info[kv[0]] = kv[1]
+	}
+
+	return info, nil
+}
+
+// splitHostPort splits an "ip:port" address into its two parts. It is
+// deliberately lenient: malformed input just comes back as (addr, "").
+func splitHostPort(addr string) (host, port string) {
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return addr, ""
+	}
+
+	return addr[:i], addr[i+1:]
+}
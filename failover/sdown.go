@@ -0,0 +1,235 @@
+package failover
+
+import (
+	"net"
+	"net/rpc"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ngaut/log"
+)
+
+const defaultDownAfter = 10 * time.Second
+
+// sdownVote is gossiped from a node that has subjectively marked a
+// master down (SDOWN) to the current raft leader, which is the only
+// node allowed to turn enough of them into an objective decision
+// (ODOWN) and start a failover.
+type sdownVote struct {
+	Addr  string
+	Voter string
+}
+
+// sdownTracker lives on every node, but votes are only recorded into a
+// node's copy while it is the leader: it is where gossiped votes accumulate until Quorum of them
+// agree within the window, which is what turns a single flaky node's
+// opinion into a cluster-wide failover decision.
+type sdownTracker struct {
+	sync.Mutex
+
+	// votes[addr][voter] is the last time voter reported addr SDOWN.
+	votes map[string]map[string]time.Time
+}
+
+func newSDownTracker() *sdownTracker {
+	return &sdownTracker{votes: make(map[string]map[string]time.Time)}
+}
+
+func (t *sdownTracker) recordLocked(vote sdownVote) {
+	if t.votes[vote.Addr] == nil {
+		t.votes[vote.Addr] = make(map[string]time.Time)
+	}
+	t.votes[vote.Addr][vote.Voter] = time.Now()
+}
+
+// voters returns the still-fresh voters for addr, i.e. the nodes this
+// failover cluster is effectively using as sentinels for that master.
+func (t *sdownTracker) voters(addr string, window time.Duration) []string {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.votersLocked(addr, window)
+}
+
+func (t *sdownTracker) votersLocked(addr string, window time.Duration) []string {
+	voters := make([]string, 0, len(t.votes[addr]))
+	now := time.Now()
+	for voter, at := range t.votes[addr] {
+		if now.Sub(at) <= window {
+			voters = append(voters, voter)
+		}
+	}
+
+	return voters
+}
+
+// recordAndCheckQuorum records vote and, in the same critical section,
+// reports whether quorum distinct voters now agree addr is SDOWN within
+// window -- clearing the vote set before returning true. Doing
+// record-check-clear as one atomic operation (rather than three
+// separately-locked calls) is what keeps two concurrent votes for the
+// same addr (the leader's own recordSDown racing a peer's gossiped
+// SDownService.Report, likely since every node's checkLoop ticks on the
+// same CheckInterval) from both observing quorum and each starting a
+// failover for the same event.
+func (t *sdownTracker) recordAndCheckQuorum(vote sdownVote, quorum int, window time.Duration) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	t.recordLocked(vote)
+
+	if len(t.votersLocked(vote.Addr, window)) < quorum {
+		return false
+	}
+
+	delete(t.votes, vote.Addr)
+	return true
+}
+
+// GetSentinelsForMaster returns the nodes of this failover cluster that
+// currently consider addr SDOWN, for observability. It reads this
+// node's own tally, so only the leader's answer is complete.
+func (app *App) GetSentinelsForMaster(addr string) []string {
+	return app.sdown.voters(addr, app.sdownWindow())
+}
+
+func (app *App) downAfter() time.Duration {
+	d := app.cfg.DownAfter
+	if d <= 0 {
+		d = defaultDownAfter
+	}
+	return d
+}
+
+func (app *App) quorum() int {
+	if app.cfg.Quorum <= 0 {
+		return 1
+	}
+	return app.cfg.Quorum
+}
+
+// sdownWindow is how long a gossiped vote stays valid. A vote older
+// than this is treated as stale, the same way a master that came back
+// up should stop counting against itself.
+func (app *App) sdownWindow() time.Duration {
+	return 2 * app.downAfter()
+}
+
+// recordSDown is called whenever this node (leader or not) observes
+// addr SDOWN. The leader tallies the vote directly; every other node
+// gossips it over RPC.
+func (app *App) recordSDown(addr string) {
+	vote := sdownVote{Addr: addr, Voter: app.cfg.Raft.Addr}
+
+	if app.r.IsLeader() {
+		app.onSDownVote(vote)
+		return
+	}
+
+	app.gossipSDown(vote)
+}
+
+// onSDownVote tallies a single vote and, once Quorum distinct voters
+// agree within the window, promotes the SDOWN into an ODOWN and starts
+// the actual failover.
+func (app *App) onSDownVote(vote sdownVote) {
+	if !app.sdown.recordAndCheckQuorum(vote, app.quorum(), app.sdownWindow()) {
+		return
+	}
+
+	if app.cfg.Mode == ModeCluster {
+		app.failoverShard(vote.Addr)
+	} else {
+		app.failover(vote.Addr)
+	}
+}
+
+// gossipSDown reports vote to whichever node currently holds the raft
+// leadership, so only the leader ever decides on a failover.
+func (app *App) gossipSDown(vote sdownVote) {
+	leader := app.r.r.Leader()
+	if leader == "" {
+		return
+	}
+
+	client, err := rpc.Dial("tcp", gossipAddr(leader, app.gossipPortOffset()))
+	if err != nil {
+		log.Errorf("dial leader %s for sdown gossip err %v", leader, err)
+		return
+	}
+	defer client.Close()
+
+	var reply bool
+	if err := client.Call("SDownService.Report", vote, &reply); err != nil {
+		log.Errorf("report sdown vote %+v to leader %s err %v", vote, leader, err)
+	}
+}
+
+// SDownService is the RPC surface every node exposes so peers can
+// gossip their SDOWN votes to it when it is the leader.
+type SDownService struct {
+	app *App
+}
+
+// Report records a peer's SDOWN vote. It is a no-op reporting to a node
+// that has since lost leadership; the voter will simply re-report to
+// the new leader on its next check.
+func (s *SDownService) Report(vote sdownVote, reply *bool) error {
+	if s.app.r.IsLeader() {
+		s.app.onSDownVote(vote)
+	}
+
+	*reply = true
+	return nil
+}
+
+// defaultGossipPortOffset is added to a node's raft port to get its
+// SDOWN-gossip RPC port when Config.Raft.GossipPortOffset isn't set.
+// It is large enough to never collide with the consecutive raft ports
+// a cluster's peers are conventionally given.
+const defaultGossipPortOffset = 10000
+
+func (app *App) gossipPortOffset() int {
+	if app.cfg.Raft.GossipPortOffset != 0 {
+		return app.cfg.Raft.GossipPortOffset
+	}
+	return defaultGossipPortOffset
+}
+
+// gossipAddr derives a node's SDOWN-gossip RPC address from its raft
+// transport address, offset by offset ports so it can't collide with
+// another peer's raft transport.
+func gossipAddr(raftAddr string, offset int) string {
+	host, port := splitHostPort(raftAddr)
+
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return raftAddr
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(p+offset))
+}
+
+func (app *App) startSDownService() error {
+	svc := &SDownService{app: app}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("SDownService", svc); err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", gossipAddr(app.cfg.Raft.Addr, app.gossipPortOffset()))
+	if err != nil {
+		return err
+	}
+	app.sdownListener = l
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		server.Accept(l)
+	}()
+
+	return nil
+}
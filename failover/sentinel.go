@@ -0,0 +1,191 @@
+package failover
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// dispatchSentinel answers the subset of the SENTINEL command family
+// needed for an unmodified Sentinel-aware client (e.g. go-redis's
+// NewFailoverClient) to discover the current master/slaves of a
+// monitored group without talking to a real Sentinel process.
+func (app *App) dispatchSentinel(w *bufio.Writer, args []string) {
+	if len(args) == 0 {
+		writeError(w, "ERR wrong number of arguments for 'sentinel' command")
+		return
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "GET-MASTER-ADDR-BY-NAME":
+		app.sentinelGetMasterAddrByName(w, args[1:])
+	case "MASTERS":
+		app.sentinelMasters(w)
+	case "MASTER":
+		app.sentinelMaster(w, args[1:])
+	case "SLAVES":
+		app.sentinelSlaves(w, args[1:])
+	case "SENTINELS":
+		app.sentinelSentinels(w, args[1:])
+	case "RESET":
+		app.sentinelReset(w, args[1:])
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown SENTINEL subcommand '%s'", args[0]))
+	}
+}
+
+func (app *App) sentinelGetMasterAddrByName(w *bufio.Writer, args []string) {
+	if len(args) != 1 {
+		writeError(w, "ERR wrong number of arguments for 'sentinel get-master-addr-by-name' command")
+		return
+	}
+
+	addr, ok := app.masters.GetAddrByName(args[0])
+	if !ok {
+		writeNullArray(w)
+		return
+	}
+
+	host, port := splitHostPort(addr)
+	writeStringArray(w, []string{host, port})
+}
+
+// masterEntry renders a single master, in the same flattened
+// field/value form real Sentinel uses for MASTERS/MASTER/SLAVES
+// replies, trimmed down to the fields this module actually tracks.
+func masterEntry(name, addr, flags string, numSlaves int) []string {
+	host, port := splitHostPort(addr)
+	return []string{
+		"name", name,
+		"ip", host,
+		"port", port,
+		"flags", flags,
+		"num-slaves", fmt.Sprintf("%d", numSlaves),
+	}
+}
+
+func (app *App) sentinelMasters(w *bufio.Writer) {
+	groups := app.masters.GetGroups()
+
+	w.WriteString(fmt.Sprintf("*%d\r\n", len(groups)))
+	for _, g := range groups {
+		writeStringArray(w, masterEntry(g.Name, g.Addr, "master", app.numSlaves(g.Addr)))
+	}
+}
+
+func (app *App) sentinelMaster(w *bufio.Writer, args []string) {
+	if len(args) != 1 {
+		writeError(w, "ERR wrong number of arguments for 'sentinel master' command")
+		return
+	}
+
+	addr, ok := app.masters.GetAddrByName(args[0])
+	if !ok {
+		writeError(w, fmt.Sprintf("ERR No such master with that name '%s'", args[0]))
+		return
+	}
+
+	writeStringArray(w, masterEntry(args[0], addr, "master", app.numSlaves(addr)))
+}
+
+func (app *App) sentinelSlaves(w *bufio.Writer, args []string) {
+	if len(args) != 1 {
+		writeError(w, "ERR wrong number of arguments for 'sentinel slaves' command")
+		return
+	}
+
+	addr, ok := app.masters.GetAddrByName(args[0])
+	if !ok {
+		writeError(w, fmt.Sprintf("ERR No such master with that name '%s'", args[0]))
+		return
+	}
+
+	app.RLock()
+	g := app.groups[addr]
+	app.RUnlock()
+
+	if g == nil {
+		writeNullArray(w)
+		return
+	}
+
+	masterHost, masterPort := splitHostPort(addr)
+
+	w.WriteString(fmt.Sprintf("*%d\r\n", len(g.Slaves)))
+	for _, slave := range g.Slaves {
+		host, port := splitHostPort(slave.Addr)
+		writeStringArray(w, []string{
+			"ip", host,
+			"port", port,
+			"flags", "slave",
+			"master-host", masterHost,
+			"master-port", masterPort,
+			"slave-repl-offset", fmt.Sprintf("%d", slave.Offset),
+		})
+	}
+}
+
+// sentinelSentinels lists the other nodes of this failover cluster as
+// if they were Sentinel processes monitoring the named group; with a
+// single process there is nothing else to report.
+func (app *App) sentinelSentinels(w *bufio.Writer, args []string) {
+	if len(args) != 1 {
+		writeError(w, "ERR wrong number of arguments for 'sentinel sentinels' command")
+		return
+	}
+
+	if _, ok := app.masters.GetAddrByName(args[0]); !ok {
+		writeError(w, fmt.Sprintf("ERR No such master with that name '%s'", args[0]))
+		return
+	}
+
+	peers := make([]string, 0, len(app.cfg.Raft.Cluster))
+	for _, peer := range app.cfg.Raft.Cluster {
+		if peer == app.cfg.Raft.Addr {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+
+	w.WriteString(fmt.Sprintf("*%d\r\n", len(peers)))
+	for _, peer := range peers {
+		host, port := splitHostPort(peer)
+		writeStringArray(w, []string{"name", peer, "ip", host, "port", port, "flags", "sentinel"})
+	}
+}
+
+// sentinelReset clears the cached replication topology of every group
+// whose name matches the glob pattern, mirroring real Sentinel's
+// "forget what you know and re-discover it on the next check" reset.
+func (app *App) sentinelReset(w *bufio.Writer, args []string) {
+	if len(args) != 1 {
+		writeError(w, "ERR wrong number of arguments for 'sentinel reset' command")
+		return
+	}
+
+	pattern := args[0]
+
+	app.Lock()
+	matched := 0
+	for addr := range app.groups {
+		if ok, _ := filepath.Match(pattern, app.masters.Name(addr)); ok {
+			delete(app.groups, addr)
+			matched++
+		}
+	}
+	app.Unlock()
+
+	writeInteger(w, matched)
+}
+
+func (app *App) numSlaves(addr string) int {
+	app.RLock()
+	defer app.RUnlock()
+
+	if g := app.groups[addr]; g != nil {
+		return len(g.Slaves)
+	}
+
+	return 0
+}
@@ -0,0 +1,197 @@
+package failover
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// handleConn serves a single client on the admin/RESP listener. It
+// understands a tiny RESP command set of its own (PING, MASTERS,
+// SUBSCRIBE, SLAVEPRIORITY and the SENTINEL family below); it is not a general purpose
+// redis server.
+func (app *App) handleConn(conn net.Conn) {
+	defer app.wg.Done()
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	sub := &subscriber{bw: bufio.NewWriter(conn)}
+	defer app.pubsub.unsubscribeAll(sub)
+
+	for {
+		args, err := readRESPCommand(br)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		if err := app.dispatch(sub, args); err != nil {
+			return
+		}
+	}
+}
+
+func (app *App) dispatch(sub *subscriber, args []string) error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	w := sub.bw
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		writeSimpleString(w, "PONG")
+	case "MASTERS":
+		writeStringArray(w, app.masters.GetMasters())
+	case "SUBSCRIBE":
+		for _, channel := range args[1:] {
+			app.pubsub.subscribe(channel, sub)
+			writeStringArray(w, []string{"subscribe", channel})
+		}
+	case "SENTINEL":
+		app.dispatchSentinel(w, args[1:])
+	case "SLAVEPRIORITY":
+		app.dispatchSlavePriority(w, args[1:])
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+
+	return w.Flush()
+}
+
+// maxRESPArgs and maxRESPBulkLen bound the multibulk count and bulk
+// string length readRESPCommand will accept. Both are attacker/mistake
+// controlled right up until this point, so they must be range-checked
+// before being used as slice sizes: a negative count or length panics
+// make() with "cap out of range", and since handleConn's goroutine has
+// no recover, that panic would take down the whole process over one
+// malformed frame.
+const (
+	maxRESPArgs    = 1024 * 1024
+	maxRESPBulkLen = 512 * 1024 * 1024
+)
+
+// readRESPCommand reads a single command from the client. Clients are
+// expected to speak the RESP array-of-bulk-strings protocol, the same
+// one every redis client library already implements.
+func readRESPCommand(br *bufio.Reader) ([]string, error) {
+	line, err := readLine(br)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return nil, fmt.Errorf("failover: expected '*', got %q", line)
+	}
+
+	n, err := parseInt(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > maxRESPArgs {
+		return nil, fmt.Errorf("failover: invalid multibulk length %d", n)
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		bulkHeader, err := readLine(br)
+		if err != nil {
+			return nil, err
+		}
+		if len(bulkHeader) == 0 || bulkHeader[0] != '$' {
+			return nil, fmt.Errorf("failover: expected '$', got %q", bulkHeader)
+		}
+
+		l, err := parseInt(bulkHeader[1:])
+		if err != nil {
+			return nil, err
+		}
+		if l < 0 || l > maxRESPBulkLen {
+			return nil, fmt.Errorf("failover: invalid bulk length %d", l)
+		}
+
+		buf := make([]byte, l+2)
+		if _, err := readFull(br, buf); err != nil {
+			return nil, err
+		}
+
+		args = append(args, string(buf[:l]))
+	}
+
+	return args, nil
+}
+
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func readFull(br *bufio.Reader, buf []byte) (int, error) {
+	total := 0
+	for total < len(buf) {
+		n, err := br.Read(buf[total:])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+func parseInt(s string) (int, error) {
+	n := 0
+	neg := false
+	for i, c := range s {
+		if i == 0 && c == '-' {
+			neg = true
+			continue
+		}
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("failover: invalid integer %q", s)
+		}
+		n = n*10 + int(c-'0')
+	}
+
+	if neg {
+		n = -n
+	}
+
+	return n, nil
+}
+
+func writeSimpleString(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "+%s\r\n", s)
+}
+
+func writeError(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "-%s\r\n", s)
+}
+
+func writeBulkString(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func writeNullBulkString(w *bufio.Writer) {
+	fmt.Fprint(w, "$-1\r\n")
+}
+
+func writeNullArray(w *bufio.Writer) {
+	fmt.Fprint(w, "*-1\r\n")
+}
+
+func writeInteger(w *bufio.Writer, n int) {
+	fmt.Fprintf(w, ":%d\r\n", n)
+}
+
+func writeStringArray(w *bufio.Writer, vals []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(vals))
+	for _, v := range vals {
+		writeBulkString(w, v)
+	}
+}
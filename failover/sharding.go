@@ -0,0 +1,89 @@
+package failover
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// shardReplicas is the number of virtual nodes per cluster member on the
+// health-check hash ring, matching the usual consistent-hashing default
+// used for ring balance (e.g. go-redis's internal/consistenthash).
+const shardReplicas = 100
+
+// hashRing assigns each checked master address to exactly one cluster
+// member, so CheckSharding can spread health checking across every node
+// instead of having each one probe every master.
+type hashRing struct {
+	keys    []uint32
+	members map[uint32]string
+}
+
+// ringHash places a key on the ring using the first four bytes of its
+// SHA-1 digest, which spreads near-identical addresses far more evenly
+// than a CRC does.
+func ringHash(key string) uint32 {
+	sum := sha1.Sum([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+func newHashRing(members []string) *hashRing {
+	r := &hashRing{members: make(map[uint32]string, len(members)*shardReplicas)}
+
+	for _, m := range members {
+		for i := 0; i < shardReplicas; i++ {
+			h := ringHash(strconv.Itoa(i) + m)
+			r.keys = append(r.keys, h)
+			r.members[h] = m
+		}
+	}
+
+	sort.Slice(r.keys, func(i, j int) bool { return r.keys[i] < r.keys[j] })
+
+	return r
+}
+
+// get returns the member owning key, or "" if the ring has no members.
+func (r *hashRing) get(key string) string {
+	if len(r.keys) == 0 {
+		return ""
+	}
+
+	h := ringHash(key)
+	i := sort.Search(len(r.keys), func(i int) bool { return r.keys[i] >= h })
+	if i == len(r.keys) {
+		i = 0
+	}
+
+	return r.members[r.keys[i]]
+}
+
+// rebuildRing recomputes the health-check hash ring from the current
+// raft peer set. It is only used in CheckSharding mode. This module has
+// no separate peer-join/peer-leave event to hook into, so checkLoop
+// calls this on every tick instead; swapping app.ring under the lock is
+// what makes the rebuild atomic with respect to owns.
+func (app *App) rebuildRing() {
+	ring := newHashRing(app.r.Peers())
+
+	app.Lock()
+	app.ring = ring
+	app.Unlock()
+}
+
+// owns reports whether this node is responsible for health-checking addr
+// under CheckSharding. Outside of CheckSharding app.ring is always nil
+// and every node owns everything, matching the original behavior. See
+// Config.CheckSharding for how this interacts with Quorum.
+func (app *App) owns(addr string) bool {
+	app.RLock()
+	ring := app.ring
+	app.RUnlock()
+
+	if ring == nil {
+		return true
+	}
+
+	return ring.get(addr) == app.cfg.Raft.Addr
+}